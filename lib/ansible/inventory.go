@@ -29,8 +29,64 @@ type Inventory map[string]Group
 
 // Group gather hosts and variables common to them
 type Group struct {
-	Hosts []string          `json:"hosts"`
-	Vars  map[string]string `json:"vars"`
+	Hosts    []string          `json:"hosts"`
+	Children []string          `json:"children,omitempty"`
+	Vars     map[string]string `json:"vars"`
+}
+
+// Meta carries the `_meta` block of an Ansible dynamic inventory. Populating
+// `hostvars` here lets Ansible call the script once with `--list` instead of
+// once per host with `--host <name>`.
+//
+// See https://docs.ansible.com/ansible/latest/dev_guide/developing_inventory.html#tuning-the-external-inventory-script
+type Meta struct {
+	HostVars map[string]map[string]string `json:"hostvars"`
+}
+
+// teleportGroup is the name of the synthetic Ansible group carrying the
+// proxy connection settings shared by every node in the inventory.
+const teleportGroup = "teleport"
+
+// proxiesGroup is the name of the auto-generated group listing the
+// Teleport proxies themselves.
+const proxiesGroup = "proxies"
+
+// DynamicInventoryConfig controls how nodes are addressed in the generated
+// inventory. When nil (or zero-valued), hosts are addressed directly by
+// their Teleport-reported address, which only works when the operator can
+// reach nodes without going through a proxy.
+//
+// When ProxyAddr is set, hosts are instead keyed by their Teleport hostname
+// and given an `ansible_ssh_common_args` ProxyCommand that tunnels the SSH
+// connection through `tsh ... ssh -W %h:%p`, so the inventory stays usable
+// from outside the private network the nodes live on.
+type DynamicInventoryConfig struct {
+	// ProxyAddr is the address of the Teleport proxy nodes should be
+	// reached through, e.g. "proxy.example.com:3023".
+	ProxyAddr string
+	// Cluster is the name of the Teleport cluster the nodes belong to. It
+	// is used both in the ProxyCommand and as an auto-generated group name.
+	Cluster string
+	// User is the OS/Teleport user tsh should log in as.
+	User string
+	// Namespace is the Teleport namespace the nodes were fetched from. It
+	// is used as an auto-generated group name.
+	Namespace string
+}
+
+// usesProxy reports whether cfg asks hosts to be reached through the
+// Teleport proxy rather than directly.
+func (cfg *DynamicInventoryConfig) usesProxy() bool {
+	return cfg != nil && cfg.ProxyAddr != ""
+}
+
+// proxyCommand builds the ansible_ssh_common_args ProxyCommand tunnelling
+// SSH through `tsh ssh -W`.
+func (cfg *DynamicInventoryConfig) proxyCommand() string {
+	return fmt.Sprintf(
+		`-o ProxyCommand="tsh --proxy=%s --cluster=%s ssh -W %%h:%%p %s@%%h"`,
+		cfg.ProxyAddr, cfg.Cluster, cfg.User,
+	)
 }
 
 // DynamicInventoryList returns a JSON-formated ouput compatible with Ansible --list flag
@@ -44,18 +100,63 @@ type Group struct {
 //             "a": true
 //         }
 //     },
+//     "_meta": {
+//         "hostvars": {
+//             "host1.example.com": {"ansible_host": "10.0.0.1"}
+//         }
+//     }
 // }
 // ```
-func DynamicInventoryList(nodes []services.Server) (string, error) {
-	hostsByLabels := bufferLabels(nodes)
+//
+// proxies is used to populate the auto-generated "proxies" group; pass nil
+// if it is not available. cfg controls whether hosts are addressed directly
+// or through the Teleport proxy; see DynamicInventoryConfig.
+func DynamicInventoryList(nodes []services.Server, proxies []services.Server, cfg *DynamicInventoryConfig) (string, error) {
+	inventory := buildInventory(nodes, proxies, cfg)
+	out, err := json.Marshal(inventory)
+	if err != nil {
+		return "", fmt.Errorf("cannot encode JSON objet: %s", err)
+	}
+	return string(out) + "\n", nil
+}
 
-	var inventory = make(map[string]Group)
-	for labelDashValue, hosts := range hostsByLabels {
-		inventory[labelDashValue] = Group{
-			Hosts: hosts,
-			Vars:  make(map[string]string),
+// GroupSpec describes one user-defined group for FilteredInventory: the
+// nodes matching Selector (a label-selector expression, see ParseSelector),
+// plus any Children group names to relate under it, producing Ansible's
+// `children:` composition (e.g. "prod_web" with children "env-prod" and
+// "role-web"). Leave Selector empty for a purely composite group.
+type GroupSpec struct {
+	Name     string
+	Selector string
+	Children []string
+}
+
+// FilteredInventory is DynamicInventoryList extended with user-defined
+// groups built from GroupSpecs. The auto-generated label-value groups (and,
+// when cfg requires a proxy, the teleport/cluster/namespace groups, and,
+// when proxies is non-empty, the proxies group)
+// are always included; GroupSpecs compose on top of them rather than
+// replacing them, so a selector like "env=prod,role!=db" can be related to
+// the existing "env-prod"/"role-db" groups via Children.
+func FilteredInventory(nodes []services.Server, proxies []services.Server, cfg *DynamicInventoryConfig, selectors []GroupSpec) (string, error) {
+	inventory := buildInventory(nodes, proxies, cfg)
+
+	for _, spec := range selectors {
+		group := Group{Vars: make(map[string]string), Children: spec.Children}
+		if spec.Selector != "" {
+			sel, err := ParseSelector(spec.Selector)
+			if err != nil {
+				return "", fmt.Errorf("ansible: group %q: %s", spec.Name, err)
+			}
+			for _, n := range nodes {
+				if sel.Matches(n.GetAllLabels()) {
+					group.Hosts = append(group.Hosts, hostID(n, cfg))
+				}
+			}
 		}
+		inventory[spec.Name] = group
 	}
+
 	out, err := json.Marshal(inventory)
 	if err != nil {
 		return "", fmt.Errorf("cannot encode JSON objet: %s", err)
@@ -63,14 +164,77 @@ func DynamicInventoryList(nodes []services.Server) (string, error) {
 	return string(out) + "\n", nil
 }
 
+// buildInventory assembles the auto-generated part of an Ansible dynamic
+// inventory shared by DynamicInventoryList and FilteredInventory: one group
+// per label/value pair, the teleport/cluster/namespace groups when cfg
+// requires a proxy, the proxies group when proxies is non-empty, and the
+// `_meta.hostvars` block.
+func buildInventory(nodes []services.Server, proxies []services.Server, cfg *DynamicInventoryConfig) map[string]interface{} {
+	hostsByLabels := bufferLabels(nodes, cfg)
+
+	inventory := make(map[string]interface{})
+	for labelDashValue, hosts := range hostsByLabels {
+		inventory[labelDashValue] = Group{
+			Hosts: hosts,
+			Vars:  make(map[string]string),
+		}
+	}
+
+	if cfg.usesProxy() {
+		var hostIDs []string
+		for _, n := range nodes {
+			hostIDs = append(hostIDs, hostID(n, cfg))
+		}
+		inventory[teleportGroup] = Group{
+			Hosts: hostIDs,
+			Vars: map[string]string{
+				"ansible_ssh_common_args": cfg.proxyCommand(),
+				"ansible_user":            cfg.User,
+			},
+		}
+		if cfg.Cluster != "" {
+			inventory[cfg.Cluster] = Group{Hosts: hostIDs, Vars: make(map[string]string)}
+		}
+		if cfg.Namespace != "" {
+			inventory[cfg.Namespace] = Group{Hosts: hostIDs, Vars: make(map[string]string)}
+		}
+	}
+
+	if len(proxies) > 0 {
+		var proxyHosts []string
+		for _, p := range proxies {
+			proxyHosts = append(proxyHosts, trimTrailingPort(p.GetAddr()))
+		}
+		inventory[proxiesGroup] = Group{Hosts: proxyHosts, Vars: make(map[string]string)}
+	}
+
+	inventory["_meta"] = Meta{HostVars: allHostVars(nodes, cfg)}
+	return inventory
+}
+
 // DynamicInventoryHost returns a JSON-formated ouput compatible with Ansible --host <string> flag
 //
 // (From ansible ref. doc)
 // When called with the arguments --host <hostname>, the script must print either an empty JSON hash/dictionary,
 // or a hash/dictionary of variables to make available to templates and playbooks.
-func DynamicInventoryHost(nodes []services.Server, host string) {
-	// print an empty dic
-	fmt.Print("{\"\":\"\"}\n")
+func DynamicInventoryHost(nodes []services.Server, host string, cfg *DynamicInventoryConfig) {
+	fmt.Print(dynamicInventoryHost(nodes, host, cfg))
+}
+
+// dynamicInventoryHost is the testable core of DynamicInventoryHost: it
+// returns the JSON-encoded hostvars for the node matching host, or an empty
+// JSON dict if no node matches, as documented by Ansible.
+func dynamicInventoryHost(nodes []services.Server, host string, cfg *DynamicInventoryConfig) string {
+	for _, n := range nodes {
+		if hostID(n, cfg) == host {
+			out, err := json.Marshal(hostVars(n, cfg))
+			if err != nil {
+				return "{}\n"
+			}
+			return string(out) + "\n"
+		}
+	}
+	return "{}\n"
 }
 
 // StaticInventory write to stdout an INI-formated ouput compatible with Ansible static inventory format
@@ -78,7 +242,7 @@ func DynamicInventoryHost(nodes []services.Server, host string) {
 // It crafts groups using the labels associated with each nodes. Each label is build in the form
 // <label>-<value> (with a dash in the middle).
 func StaticInventory(nodes []services.Server) {
-	inventory := bufferLabels(nodes)
+	inventory := bufferLabels(nodes, nil)
 	// write one tulpe by keys
 	for groupName, nodeIPs := range inventory {
 		fmt.Println("[" + groupName + "]")
@@ -89,7 +253,7 @@ func StaticInventory(nodes []services.Server) {
 }
 
 // bufferLabels gather labels values and create groups associating hosts with identical labels values
-func bufferLabels(nodes []services.Server) map[string][]string {
+func bufferLabels(nodes []services.Server, cfg *DynamicInventoryConfig) map[string][]string {
 	labelBuffer := make(map[string][]string)
 	// get all keys
 	for _, n := range nodes {
@@ -97,15 +261,71 @@ func bufferLabels(nodes []services.Server) map[string][]string {
 		for label, val := range n.GetAllLabels() {
 			// groupName is of the form apache-2.2
 			groupName := label + "-" + val
-			// remove trailing port in host (if any)
-			IP := trimTrailingPort(n.GetAddr())
-			labelBuffer[groupName] = append(labelBuffer[groupName], IP)
+			labelBuffer[groupName] = append(labelBuffer[groupName], hostID(n, cfg))
 		}
 	}
 	return labelBuffer
 }
 
+// hostID returns the identifier a node is addressed by in the generated
+// inventory. Nodes are addressed directly by their trimmed address unless
+// cfg asks for proxying, in which case nodes are unreachable by address and
+// must instead be addressed by their Teleport hostname (falling back to
+// their UUID if the hostname isn't set).
+func hostID(n services.Server, cfg *DynamicInventoryConfig) string {
+	if !cfg.usesProxy() {
+		return trimTrailingPort(n.GetAddr())
+	}
+	if n.GetHostname() != "" {
+		return n.GetHostname()
+	}
+	return n.GetName()
+}
+
+// allHostVars builds the `_meta.hostvars` block of DynamicInventoryList: the
+// same per-host dictionary that DynamicInventoryHost would return, for every
+// node, keyed by the host identifier used in the group's `hosts` list.
+func allHostVars(nodes []services.Server, cfg *DynamicInventoryConfig) map[string]map[string]string {
+	vars := make(map[string]map[string]string, len(nodes))
+	for _, n := range nodes {
+		vars[hostID(n, cfg)] = hostVars(n, cfg)
+	}
+	return vars
+}
+
+// hostVars derives the Ansible host variables for a single Teleport node:
+// the address and port Ansible should connect to, plus the node's hostname,
+// namespace and every Teleport label promoted to a top-level variable. When
+// cfg asks for proxying, it also carries the ProxyCommand and login user
+// needed to reach the node through the Teleport proxy.
+func hostVars(n services.Server, cfg *DynamicInventoryConfig) map[string]string {
+	vars := map[string]string{
+		"ansible_host": trimTrailingPort(n.GetAddr()),
+		"ansible_port": trailingPort(n.GetAddr()),
+		"hostname":     n.GetHostname(),
+		"namespace":    n.GetNamespace(),
+	}
+	for label, val := range n.GetAllLabels() {
+		vars[label] = val
+	}
+	if cfg.usesProxy() {
+		vars["ansible_ssh_common_args"] = cfg.proxyCommand()
+		vars["ansible_user"] = cfg.User
+	}
+	return vars
+}
+
 func trimTrailingPort(nodeAddr string) (nodeIP string) {
 	nodeIP = strings.Split(nodeAddr, ":")[0]
 	return
 }
+
+// trailingPort extracts the port from a node address of the form
+// "host:port", defaulting to Teleport's standard SSH port when none is set.
+func trailingPort(nodeAddr string) (port string) {
+	parts := strings.Split(nodeAddr, ":")
+	if len(parts) < 2 {
+		return "3022"
+	}
+	return parts[len(parts)-1]
+}
@@ -17,6 +17,7 @@ limitations under the License.
 package ansible
 
 import (
+	"encoding/json"
 	"strings"
 	"testing"
 
@@ -31,7 +32,7 @@ var serverFixture = []services.Server{
 			},
 		},
 		Spec: services.ServerSpecV2{
-			Addr:     "198.145.29.83",
+			Addr:     "198.145.29.83:3022",
 			Hostname: "kernel.org",
 		},
 	},
@@ -43,7 +44,7 @@ var serverFixture = []services.Server{
 			},
 		},
 		Spec: services.ServerSpecV2{
-			Addr:     "11.1.1.1",
+			Addr:     "11.1.1.1:22",
 			Hostname: "coreos.local",
 		},
 	},
@@ -61,21 +62,169 @@ var serverFixture = []services.Server{
 	},
 }
 
+func TestDynamicInventoryList(t *testing.T) {
+	jsonInventory, err := DynamicInventoryList(serverFixture, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var inventory map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(jsonInventory), &inventory); err != nil {
+		t.Fatalf("invalid JSON output: %s", err)
+	}
+
+	for _, group := range []string{"os-gentoo", "os-coreos", "os-plan9", "role-database"} {
+		if _, ok := inventory[group]; !ok {
+			t.Errorf("expected group %q in inventory", group)
+		}
+	}
+
+	rawMeta, ok := inventory["_meta"]
+	if !ok {
+		t.Fatal("expected a _meta block in the inventory")
+	}
+	var meta Meta
+	if err := json.Unmarshal(rawMeta, &meta); err != nil {
+		t.Fatalf("invalid _meta block: %s", err)
+	}
+
+	hv, ok := meta.HostVars["198.145.29.83"]
+	if !ok {
+		t.Fatal("expected hostvars for 198.145.29.83")
+	}
+	if hv["ansible_host"] != "198.145.29.83" || hv["ansible_port"] != "3022" {
+		t.Errorf("unexpected ansible_host/ansible_port: %+v", hv)
+	}
+	if hv["hostname"] != "kernel.org" || hv["os"] != "gentoo" {
+		t.Errorf("unexpected hostvars: %+v", hv)
+	}
+}
+
 func TestDynamicInventoryHost(t *testing.T) {
-	jsonInventory, err := DynamicInventoryList(serverFixture)
+	hv := decodeHostVars(t, dynamicInventoryHost(serverFixture, "11.1.1.1", nil))
+	if hv["hostname"] != "coreos.local" || hv["ansible_port"] != "22" || hv["role"] != "database" {
+		t.Errorf("unexpected hostvars for known host: %+v", hv)
+	}
+	if _, ok := hv["ansible_ssh_common_args"]; ok {
+		t.Error("ansible_ssh_common_args should not be set without a proxy config")
+	}
+
+	empty := decodeHostVars(t, dynamicInventoryHost(serverFixture, "does-not-exist", nil))
+	if len(empty) != 0 {
+		t.Errorf("expected an empty dict for an unknown host, got: %+v", empty)
+	}
+}
+
+func TestDynamicInventoryListWithProxy(t *testing.T) {
+	cfg := &DynamicInventoryConfig{
+		ProxyAddr: "proxy.example.com:3023",
+		Cluster:   "prod",
+		User:      "ops",
+		Namespace: "default",
+	}
+	proxies := []services.Server{
+		&services.ServerV2{
+			Spec: services.ServerSpecV2{Addr: "proxy.example.com:3023"},
+		},
+	}
+
+	jsonInventory, err := DynamicInventoryList(serverFixture, proxies, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var inventory map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(jsonInventory), &inventory); err != nil {
+		t.Fatalf("invalid JSON output: %s", err)
+	}
+
+	var teleport Group
+	if err := json.Unmarshal(inventory["teleport"], &teleport); err != nil {
+		t.Fatalf("expected a teleport group: %s", err)
+	}
+	if teleport.Vars["ansible_user"] != "ops" {
+		t.Errorf("expected ansible_user=ops, got %+v", teleport.Vars)
+	}
+	if !strings.Contains(teleport.Vars["ansible_ssh_common_args"], "tsh --proxy=proxy.example.com:3023") {
+		t.Errorf("unexpected ProxyCommand: %+v", teleport.Vars)
+	}
+	for _, group := range []string{"prod", "default", "proxies"} {
+		if _, ok := inventory[group]; !ok {
+			t.Errorf("expected auto-generated group %q", group)
+		}
+	}
+
+	hv := decodeHostVars(t, dynamicInventoryHost(serverFixture, "kernel.org", cfg))
+	if hv["ansible_user"] != "ops" || hv["hostname"] != "kernel.org" {
+		t.Errorf("unexpected hostvars for proxied host: %+v", hv)
+	}
+}
+
+func TestFilteredInventory(t *testing.T) {
+	selectors := []GroupSpec{
+		{Name: "databases", Selector: "role=database,os!=plan9"},
+		{Name: "tagged", Selector: "os in (gentoo,coreos)"},
+		{Name: "everything", Children: []string{"databases", "tagged"}},
+	}
+
+	jsonInventory, err := FilteredInventory(serverFixture, nil, nil, selectors)
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
 	}
 
-	encodedJSON :=
-		`{"Groups":{
-			"os-coreos":{"Hosts":["11.1.1.1"],"Vars":{}},
-			"os-gentoo":{"Hosts":["198.145.29.83"],"Vars":{}},
-			"os-plan9":{"Hosts":["8.8.4.4"],"Vars":{}},
-			"role-database":{"Hosts":["11.1.1.1","8.8.4.4"],"Vars":{}},
-			"time-now":{"Hosts":["198.145.29.83","11.1.1.1","8.8.4.4"],"Vars":{}}
-		}}`
-	if !strings.EqualFold(jsonInventory, strings.TrimSpace(encodedJSON)) {
-		t.Error("mismatch in json output")
+	var inventory map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(jsonInventory), &inventory); err != nil {
+		t.Fatalf("invalid JSON output: %s", err)
+	}
+
+	var databases, tagged, everything Group
+	mustUnmarshal(t, inventory["databases"], &databases)
+	mustUnmarshal(t, inventory["tagged"], &tagged)
+	mustUnmarshal(t, inventory["everything"], &everything)
+
+	if !sameSet(databases.Hosts, []string{"11.1.1.1"}) {
+		t.Errorf("expected databases to match only the coreos database, got %+v", databases.Hosts)
+	}
+	if !sameSet(tagged.Hosts, []string{"198.145.29.83", "11.1.1.1"}) {
+		t.Errorf("unexpected tagged hosts: %+v", tagged.Hosts)
+	}
+	if !sameSet(everything.Children, []string{"databases", "tagged"}) {
+		t.Errorf("expected everything to list databases and tagged as children, got %+v", everything.Children)
+	}
+
+	// selectors compose with, rather than replace, the auto-generated groups
+	if _, ok := inventory["role-database"]; !ok {
+		t.Error("expected the auto-generated role-database group to still be present")
+	}
+}
+
+func mustUnmarshal(t *testing.T, raw json.RawMessage, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(raw, v); err != nil {
+		t.Fatalf("invalid JSON: %s", err)
+	}
+}
+
+func sameSet(got, want []string) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	index := make(map[string]bool, len(want))
+	for _, w := range want {
+		index[w] = true
+	}
+	for _, g := range got {
+		if !index[g] {
+			return false
+		}
+	}
+	return true
+}
+
+func decodeHostVars(t *testing.T, out string) map[string]string {
+	var hv map[string]string
+	if err := json.Unmarshal([]byte(out), &hv); err != nil {
+		t.Fatalf("invalid JSON output %q: %s", out, err)
 	}
+	return hv
 }
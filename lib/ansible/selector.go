@@ -0,0 +1,150 @@
+/*
+Copyright 2017 Maximilien Richer
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ansible
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Selector is a parsed, Kubernetes label-selector-style expression, e.g.
+// "env=prod,role!=db,tier in (web,api)", used by FilteredInventory to
+// decide which nodes belong to a user-defined group.
+type Selector struct {
+	requirements []requirement
+}
+
+// requirement is a single comma-separated clause of a Selector.
+type requirement struct {
+	key      string
+	operator string // "=", "!=", "in", "notin"
+	values   map[string]struct{}
+}
+
+// ParseSelector parses a selector expression of the form
+// "key=value,key2!=value2,key3 in (a,b)". An empty expression is a valid
+// selector that matches everything.
+func ParseSelector(expr string) (Selector, error) {
+	expr = strings.TrimSpace(expr)
+	if expr == "" {
+		return Selector{}, nil
+	}
+
+	var sel Selector
+	for _, clause := range splitClauses(expr) {
+		req, err := parseClause(clause)
+		if err != nil {
+			return Selector{}, err
+		}
+		sel.requirements = append(sel.requirements, req)
+	}
+	return sel, nil
+}
+
+// Matches reports whether labels satisfies every requirement of s.
+func (s Selector) Matches(labels map[string]string) bool {
+	for _, req := range s.requirements {
+		if !req.matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+func (r requirement) matches(labels map[string]string) bool {
+	val, ok := labels[r.key]
+	switch r.operator {
+	case "=":
+		return ok && r.hasValue(val)
+	case "!=":
+		return !ok || !r.hasValue(val)
+	case "in":
+		return ok && r.hasValue(val)
+	case "notin":
+		return !ok || !r.hasValue(val)
+	default:
+		return false
+	}
+}
+
+func (r requirement) hasValue(v string) bool {
+	_, ok := r.values[v]
+	return ok
+}
+
+// splitClauses splits a selector expression on top-level commas, leaving
+// commas inside an `in (...)`/`notin (...)` value list untouched.
+func splitClauses(expr string) []string {
+	var clauses []string
+	depth := 0
+	start := 0
+	for i, r := range expr {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				clauses = append(clauses, strings.TrimSpace(expr[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	clauses = append(clauses, strings.TrimSpace(expr[start:]))
+	return clauses
+}
+
+// parseClause parses a single selector clause into a requirement.
+func parseClause(clause string) (requirement, error) {
+	switch {
+	case strings.Contains(clause, " notin "):
+		return parseSetClause(clause, " notin ", "notin")
+	case strings.Contains(clause, " in "):
+		return parseSetClause(clause, " in ", "in")
+	case strings.Contains(clause, "!="):
+		parts := strings.SplitN(clause, "!=", 2)
+		return requirement{key: strings.TrimSpace(parts[0]), operator: "!=", values: valueSet(parts[1])}, nil
+	case strings.Contains(clause, "="):
+		parts := strings.SplitN(clause, "=", 2)
+		return requirement{key: strings.TrimSpace(parts[0]), operator: "=", values: valueSet(parts[1])}, nil
+	default:
+		return requirement{}, fmt.Errorf("ansible: invalid selector clause %q", clause)
+	}
+}
+
+// parseSetClause parses a `key in (a,b)` / `key notin (a,b)` clause.
+func parseSetClause(clause, sep, operator string) (requirement, error) {
+	parts := strings.SplitN(clause, sep, 2)
+	if len(parts) != 2 {
+		return requirement{}, fmt.Errorf("ansible: invalid selector clause %q", clause)
+	}
+	key := strings.TrimSpace(parts[0])
+	values := strings.TrimSpace(parts[1])
+	values = strings.TrimPrefix(values, "(")
+	values = strings.TrimSuffix(values, ")")
+	return requirement{key: key, operator: operator, values: valueSet(values)}, nil
+}
+
+// valueSet turns a comma-separated value list into a lookup set.
+func valueSet(raw string) map[string]struct{} {
+	set := make(map[string]struct{})
+	for _, v := range strings.Split(raw, ",") {
+		set[strings.TrimSpace(v)] = struct{}{}
+	}
+	return set
+}
@@ -0,0 +1,55 @@
+/*
+Copyright 2017 Maximilien Richer
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ansible
+
+import "testing"
+
+func TestSelectorMatches(t *testing.T) {
+	tests := []struct {
+		expr   string
+		labels map[string]string
+		want   bool
+	}{
+		{"env=prod", map[string]string{"env": "prod"}, true},
+		{"env=prod", map[string]string{"env": "staging"}, false},
+		{"role!=db", map[string]string{"role": "web"}, true},
+		{"role!=db", map[string]string{"role": "db"}, false},
+		{"role!=db", map[string]string{}, true},
+		{"tier in (web,api)", map[string]string{"tier": "api"}, true},
+		{"tier in (web,api)", map[string]string{"tier": "db"}, false},
+		{"tier notin (web,api)", map[string]string{"tier": "db"}, true},
+		{"env=prod,role!=db", map[string]string{"env": "prod", "role": "web"}, true},
+		{"env=prod,role!=db", map[string]string{"env": "prod", "role": "db"}, false},
+		{"", map[string]string{"env": "prod"}, true},
+	}
+
+	for _, tt := range tests {
+		sel, err := ParseSelector(tt.expr)
+		if err != nil {
+			t.Fatalf("ParseSelector(%q): %s", tt.expr, err)
+		}
+		if got := sel.Matches(tt.labels); got != tt.want {
+			t.Errorf("Selector(%q).Matches(%+v) = %v, want %v", tt.expr, tt.labels, got, tt.want)
+		}
+	}
+}
+
+func TestParseSelectorInvalid(t *testing.T) {
+	if _, err := ParseSelector("not-a-valid-clause"); err == nil {
+		t.Error("expected an error for a clause with no operator")
+	}
+}
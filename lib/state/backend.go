@@ -0,0 +1,39 @@
+/*
+Copyright 2017 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package state
+
+// Backend is the persistence contract CachingAuthClient needs to survive a
+// process restart. Implementations only have to provide flat key/value
+// storage; CachingAuthClient owns all JSON (de)serialization on top of it.
+//
+// BoltBackend (a single file, the default) and EtcdBackend (etcd v3, for HA
+// proxy pools that want to share one cache) are the two backends shipped
+// here, modeled on dex's pluggable storage split.
+type Backend interface {
+	// Get returns the value stored at key. It returns a trace.NotFound
+	// error if key does not exist.
+	Get(key string) ([]byte, error)
+	// Put stores value at key, creating or overwriting it.
+	Put(key string, value []byte) error
+	// List returns every key currently stored under prefix.
+	List(prefix string) ([]string, error)
+	// Delete removes key. It is a no-op if key does not exist.
+	Delete(key string) error
+	// Close releases any resources held by the backend.
+	Close() error
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2017 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package state
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/gravitational/trace"
+)
+
+// bucketName is the single bolt bucket CachingAuthClient's cache lives in.
+var bucketName = []byte("state")
+
+// BoltBackend is the default Backend: a single boltdb file on disk, good
+// for tctl and single-proxy hosts that don't need to share their cache
+// with another process.
+type BoltBackend struct {
+	db *bolt.DB
+}
+
+// NewBoltBackend opens (creating if necessary) a boltdb file at path.
+func NewBoltBackend(path string) (*BoltBackend, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bucketName)
+		return err
+	})
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return &BoltBackend{db: db}, nil
+}
+
+// Get is a part of the Backend implementation
+func (b *BoltBackend) Get(key string) ([]byte, error) {
+	var value []byte
+	err := b.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(bucketName).Get([]byte(key))
+		if v == nil {
+			return trace.NotFound("key %q not found", key)
+		}
+		value = append([]byte{}, v...)
+		return nil
+	})
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return value, nil
+}
+
+// Put is a part of the Backend implementation
+func (b *BoltBackend) Put(key string, value []byte) error {
+	return trace.Wrap(b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketName).Put([]byte(key), value)
+	}))
+}
+
+// List is a part of the Backend implementation
+func (b *BoltBackend) List(prefix string) ([]string, error) {
+	var keys []string
+	err := b.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(bucketName).Cursor()
+		p := []byte(prefix)
+		for k, _ := c.Seek(p); k != nil && bytes.HasPrefix(k, p); k, _ = c.Next() {
+			keys = append(keys, string(k))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return keys, nil
+}
+
+// Delete is a part of the Backend implementation
+func (b *BoltBackend) Delete(key string) error {
+	return trace.Wrap(b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketName).Delete([]byte(key))
+	}))
+}
+
+// Close is a part of the Backend implementation
+func (b *BoltBackend) Close() error {
+	return trace.Wrap(b.db.Close())
+}
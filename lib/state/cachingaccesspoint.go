@@ -18,6 +18,9 @@ limitations under the License.
 package state
 
 import (
+	"encoding/json"
+	"math/rand"
+	"strconv"
 	"sync"
 	"time"
 
@@ -29,173 +32,615 @@ import (
 )
 
 const (
-	backoffDuration = time.Second * 10
+	// DefaultCacheTTL is how often each cached resource is refreshed from
+	// the auth server in the background when CacheConfig.TTL is unset.
+	DefaultCacheTTL = 30 * time.Second
+
+	// DefaultMaxStaleness bounds how long stale data keeps being served
+	// after refreshes start failing when CacheConfig.MaxStaleness is unset.
+	DefaultMaxStaleness = 5 * time.Minute
+
+	// maxRefreshJitter is added on top of the TTL of every background
+	// refresh so that many CachingAuthClients don't all hit the auth
+	// server at the same instant.
+	maxRefreshJitter = 5 * time.Second
+
+	// cacheSchemaVersion is bumped whenever the shape of the objects
+	// written to Backend changes in an incompatible way, so a cache left
+	// over from an older release is wiped instead of misinterpreted.
+	cacheSchemaVersion = 1
+)
+
+// key paths used to persist cached values to Backend.
+const (
+	keySchemaVersion = "schema_version"
+	keyDomainName    = "domain_name"
+	keyNamespaces    = "namespaces"
+	keyNodesPrefix   = "nodes/"
+	keyProxies       = "proxies"
+	keyUsers         = "users"
+	keyUserCAs       = "user_cas"
+	keyHostCAs       = "host_cas"
 )
 
+// CacheConfig controls how often CachingAuthClient refreshes each cached
+// resource, and how long it keeps serving stale data once refreshes start
+// failing.
+type CacheConfig struct {
+	// TTL is the background refresh interval for every cached resource.
+	// Defaults to DefaultCacheTTL.
+	TTL time.Duration
+	// MaxStaleness is the stale-if-error window: how long a resource keeps
+	// being served from cache after its refreshes start failing, before
+	// reads start returning trace.ConnectionProblem. Defaults to
+	// DefaultMaxStaleness.
+	MaxStaleness time.Duration
+}
+
+func (cfg CacheConfig) ttl() time.Duration {
+	if cfg.TTL <= 0 {
+		return DefaultCacheTTL
+	}
+	return cfg.TTL
+}
+
+func (cfg CacheConfig) maxStaleness() time.Duration {
+	if cfg.MaxStaleness <= 0 {
+		return DefaultMaxStaleness
+	}
+	return cfg.MaxStaleness
+}
+
+// cacheEntry tracks the freshness of a single cached resource. It is always
+// read and written while holding CachingAuthClient.mu, so it needs no
+// locking of its own.
+type cacheEntry struct {
+	// lastSuccess is when this resource was last refreshed successfully.
+	lastSuccess time.Time
+	// firstError is when refreshes of this resource started failing; it is
+	// the zero value while the resource is healthy.
+	firstError time.Time
+}
+
+func (e *cacheEntry) recordSuccess() {
+	e.lastSuccess = time.Now()
+	e.firstError = time.Time{}
+}
+
+func (e *cacheEntry) recordError() {
+	if e.firstError.IsZero() {
+		e.firstError = time.Now()
+	}
+}
+
+// usable reports whether the resource has ever been populated (from a live
+// refresh or hydrated from backend) and is either fresh or stale but still
+// within the stale-if-error window. A resource that has never succeeded is
+// never usable, regardless of how recent firstError is.
+func (e *cacheEntry) usable(maxStale time.Duration) bool {
+	if e.lastSuccess.IsZero() {
+		return false
+	}
+	return e.firstError.IsZero() || time.Since(e.firstError) < maxStale
+}
+
 // CachingAuthClient implements auth.AccessPoint interface and remembers
 // the previously returned upstream value for each API call.
 //
-// This which can be used if the upstream AccessPoint goes offline
+// This which can be used if the upstream AccessPoint goes offline. Each
+// cached resource is refreshed on its own background schedule instead of on
+// the read path, reads are served under an RWMutex with no upstream I/O,
+// and values are written through to a persistent Backend so a process that
+// restarts while the auth server is unreachable still comes up serving the
+// last known-good state.
 type CachingAuthClient struct {
-	sync.Mutex
-
 	// ap points to the access ponit we're caching access to:
 	ap auth.AccessPoint
 
-	// timestamp of the last error when talking to the AP
-	lastErrorTime time.Time
+	// backend persists cached values across restarts. It may be nil, in
+	// which case CachingAuthClient behaves as an in-memory-only cache that
+	// starts empty.
+	backend Backend
+
+	ttl          time.Duration
+	maxStaleness time.Duration
+
+	stopCh   chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+
+	mu sync.RWMutex // guards every field below, and every *cacheEntry
 
-	//
-	// fields below are the cached values received from the AP:
-	//
+	domainName      string
+	domainNameState *cacheEntry
+
+	namespaces      []services.Namespace
+	namespacesState *cacheEntry
 
-	domainName string
-	namespaces []services.Namespace
 	nodes      map[string][]services.Server
-	proxies    []services.Server
+	nodesState map[string]*cacheEntry
+
+	proxies      []services.Server
+	proxiesState *cacheEntry
+
 	users      []services.User
-	userCAs    []*services.CertAuthority
-	hostCAs    []*services.CertAuthority
+	usersState *cacheEntry
+
+	userCAs      []*services.CertAuthority
+	userCAsState *cacheEntry
+
+	hostCAs      []*services.CertAuthority
+	hostCAsState *cacheEntry
 }
 
 // NewCachingAuthClient creates a new instance of CachingAuthClient using a
-// live connection to the auth server (ap)
-func NewCachingAuthClient(ap auth.AccessPoint) (*CachingAuthClient, error) {
-	// read everything from the auth access point:
-	domainName, err := ap.GetDomainName()
-	if err != nil {
+// live connection to the auth server (ap), persisting everything it learns
+// to backend and refreshing it in the background according to cfg. If ap is
+// unreachable at construction time, CachingAuthClient hydrates its
+// in-memory state from backend instead of failing to start.
+func NewCachingAuthClient(ap auth.AccessPoint, backend Backend, cfg CacheConfig) (*CachingAuthClient, error) {
+	cs := &CachingAuthClient{
+		ap:           ap,
+		backend:      backend,
+		ttl:          cfg.ttl(),
+		maxStaleness: cfg.maxStaleness(),
+		stopCh:       make(chan struct{}),
+
+		nodes:           make(map[string][]services.Server),
+		nodesState:      make(map[string]*cacheEntry),
+		domainNameState: &cacheEntry{},
+		namespacesState: &cacheEntry{},
+		proxiesState:    &cacheEntry{},
+		usersState:      &cacheEntry{},
+		userCAsState:    &cacheEntry{},
+		hostCAsState:    &cacheEntry{},
+	}
+
+	if err := cs.checkSchemaVersion(); err != nil {
 		return nil, trace.Wrap(err)
 	}
-	namespaces, err := ap.GetNamespaces()
-	if err != nil {
+
+	// populate the initial state synchronously so the caller gets an
+	// immediately-usable client; any resource that fails here falls back to
+	// whatever was last persisted to backend.
+	cs.refreshDomainName()
+	cs.refreshNamespaces()
+	cs.refreshNodes()
+	cs.refreshProxies()
+	cs.refreshUsers()
+	cs.refreshCertAuthorities(services.UserCA)
+	cs.refreshCertAuthorities(services.HostCA)
+
+	if err := cs.hydrateFailed(); err != nil {
 		return nil, trace.Wrap(err)
 	}
-	nodes := make(map[string][]services.Server, len(namespaces))
+
+	cs.startRefreshers()
+	return cs, nil
+}
+
+// startRefreshers launches one background goroutine per cached resource.
+func (cs *CachingAuthClient) startRefreshers() {
+	cs.startRefresher("domain_name", cs.refreshDomainName)
+	cs.startRefresher("namespaces", cs.refreshNamespaces)
+	cs.startRefresher("nodes", cs.refreshNodes)
+	cs.startRefresher("proxies", cs.refreshProxies)
+	cs.startRefresher("users", cs.refreshUsers)
+	cs.startRefresher("user_cas", func() error { return cs.refreshCertAuthorities(services.UserCA) })
+	cs.startRefresher("host_cas", func() error { return cs.refreshCertAuthorities(services.HostCA) })
+}
+
+// startRefresher runs refresh every cs.ttl (plus jitter) until Close stops
+// it.
+func (cs *CachingAuthClient) startRefresher(resource string, refresh func() error) {
+	cs.wg.Add(1)
+	go func() {
+		defer cs.wg.Done()
+		for {
+			select {
+			case <-cs.stopCh:
+				return
+			case <-time.After(cs.ttl + time.Duration(rand.Int63n(int64(maxRefreshJitter)))):
+				if err := refresh(); err != nil {
+					log.Warningf("state: background refresh of %s failed: %v", resource, err)
+					refreshFailures.WithLabelValues(resource).Inc()
+				}
+			}
+		}
+	}()
+}
+
+// Close stops every background refresher and closes the backend. It is
+// safe to call more than once.
+func (cs *CachingAuthClient) Close() error {
+	cs.stopOnce.Do(func() {
+		close(cs.stopCh)
+	})
+	cs.wg.Wait()
+	if cs.backend != nil {
+		return trace.Wrap(cs.backend.Close())
+	}
+	return nil
+}
+
+// refreshDomainName is the background refresh func for the domain name.
+func (cs *CachingAuthClient) refreshDomainName() error {
+	dn, err := cs.ap.GetDomainName()
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if err != nil {
+		cs.domainNameState.recordError()
+		return trace.Wrap(err)
+	}
+	cs.domainName = dn
+	cs.domainNameState.recordSuccess()
+	cs.putCache(keyDomainName, dn)
+	lastSuccessTimestamp.WithLabelValues("domain_name").Set(float64(cs.domainNameState.lastSuccess.Unix()))
+	return nil
+}
+
+// refreshNamespaces is the background refresh func for namespaces.
+func (cs *CachingAuthClient) refreshNamespaces() error {
+	namespaces, err := cs.ap.GetNamespaces()
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if err != nil {
+		cs.namespacesState.recordError()
+		return trace.Wrap(err)
+	}
+	cs.namespaces = namespaces
+	cs.namespacesState.recordSuccess()
+	cs.putCache(keyNamespaces, namespaces)
+	lastSuccessTimestamp.WithLabelValues("namespaces").Set(float64(cs.namespacesState.lastSuccess.Unix()))
+	return nil
+}
+
+// refreshNodes is the background refresh func for nodes: it refreshes
+// every namespace known at the time it runs, and reports the first error
+// encountered (if any) while still refreshing the rest.
+func (cs *CachingAuthClient) refreshNodes() error {
+	cs.mu.RLock()
+	namespaces := cs.namespaces
+	cs.mu.RUnlock()
+
+	var firstErr error
 	for _, ns := range namespaces {
-		nsNodes, err := ap.GetNodes(ns.Metadata.Name)
+		nsNodes, err := cs.ap.GetNodes(ns.Metadata.Name)
+
+		cs.mu.Lock()
+		entry := cs.nodesState[ns.Metadata.Name]
+		if entry == nil {
+			entry = &cacheEntry{}
+			cs.nodesState[ns.Metadata.Name] = entry
+		}
 		if err != nil {
-			return nil, trace.Wrap(err)
+			entry.recordError()
+			if firstErr == nil {
+				firstErr = err
+			}
+		} else {
+			cs.nodes[ns.Metadata.Name] = nsNodes
+			entry.recordSuccess()
+			cs.putServersCache(keyNodesPrefix+ns.Metadata.Name, nsNodes)
+			lastSuccessTimestamp.WithLabelValues("nodes").Set(float64(entry.lastSuccess.Unix()))
 		}
-		nodes[ns.Metadata.Name] = nsNodes
+		cs.mu.Unlock()
 	}
-	proxies, err := ap.GetProxies()
+	return trace.Wrap(firstErr)
+}
+
+// refreshProxies is the background refresh func for proxies.
+func (cs *CachingAuthClient) refreshProxies() error {
+	proxies, err := cs.ap.GetProxies()
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
 	if err != nil {
-		return nil, trace.Wrap(err)
+		cs.proxiesState.recordError()
+		return trace.Wrap(err)
 	}
-	users, err := ap.GetUsers()
+	cs.proxies = proxies
+	cs.proxiesState.recordSuccess()
+	cs.putServersCache(keyProxies, proxies)
+	lastSuccessTimestamp.WithLabelValues("proxies").Set(float64(cs.proxiesState.lastSuccess.Unix()))
+	return nil
+}
+
+// refreshUsers is the background refresh func for users.
+func (cs *CachingAuthClient) refreshUsers() error {
+	users, err := cs.ap.GetUsers()
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
 	if err != nil {
-		return nil, trace.Wrap(err)
+		cs.usersState.recordError()
+		return trace.Wrap(err)
 	}
-	userCAs, err := ap.GetCertAuthorities(services.UserCA, false)
+	cs.users = users
+	cs.usersState.recordSuccess()
+	cs.putCache(keyUsers, users)
+	lastSuccessTimestamp.WithLabelValues("users").Set(float64(cs.usersState.lastSuccess.Unix()))
+	return nil
+}
+
+// refreshCertAuthorities is the background refresh func for user/host CAs.
+func (cs *CachingAuthClient) refreshCertAuthorities(ct services.CertAuthType) error {
+	retval, err := cs.ap.GetCertAuthorities(ct, false)
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	name, state := "host_cas", cs.hostCAsState
+	if ct == services.UserCA {
+		name, state = "user_cas", cs.userCAsState
+	}
+
 	if err != nil {
-		return nil, trace.Wrap(err)
+		state.recordError()
+		return trace.Wrap(err)
+	}
+	if ct == services.UserCA {
+		cs.userCAs = retval
+		cs.putCache(keyUserCAs, retval)
+	} else {
+		cs.hostCAs = retval
+		cs.putCache(keyHostCAs, retval)
 	}
-	hostCAs, err := ap.GetCertAuthorities(services.HostCA, false)
+	state.recordSuccess()
+	lastSuccessTimestamp.WithLabelValues(name).Set(float64(state.lastSuccess.Unix()))
+	return nil
+}
+
+// hydrateFailed loads, from backend, the data for every resource whose
+// initial refresh in NewCachingAuthClient failed, marking each one
+// recovered (recordSuccess) if hydration found something and leaving it
+// recorded as failed (so cacheEntry.usable reports it as never-populated)
+// otherwise. It returns an error only if the domain name -- needed to
+// identify the cluster at all -- could neither be fetched live nor
+// recovered from backend.
+func (cs *CachingAuthClient) hydrateFailed() error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	if !cs.domainNameState.firstError.IsZero() {
+		if err := cs.getCache(keyDomainName, &cs.domainName); err != nil {
+			return trace.Wrap(err)
+		}
+		cs.domainNameState.recordSuccess()
+	}
+	if !cs.namespacesState.firstError.IsZero() {
+		if cs.getCache(keyNamespaces, &cs.namespaces) == nil {
+			cs.namespacesState.recordSuccess()
+		}
+	}
+	// cs.namespaces is only populated above (either by the live refresh or
+	// by the hydration just above), so nodesState may not yet have an entry
+	// for every namespace even though none of them has ever been
+	// successfully fetched: create one on demand rather than skipping
+	// hydration for namespaces refreshNodes never got to see.
+	for _, ns := range cs.namespaces {
+		entry := cs.nodesState[ns.Metadata.Name]
+		if entry == nil {
+			entry = &cacheEntry{}
+			cs.nodesState[ns.Metadata.Name] = entry
+		}
+		if !entry.lastSuccess.IsZero() {
+			continue // already populated by a live refresh
+		}
+		if nsNodes, err := cs.getServersCache(keyNodesPrefix + ns.Metadata.Name); err == nil {
+			cs.nodes[ns.Metadata.Name] = nsNodes
+			entry.recordSuccess()
+		}
+	}
+	if !cs.proxiesState.firstError.IsZero() {
+		if proxies, err := cs.getServersCache(keyProxies); err == nil {
+			cs.proxies = proxies
+			cs.proxiesState.recordSuccess()
+		}
+	}
+	if !cs.usersState.firstError.IsZero() {
+		if cs.getCache(keyUsers, &cs.users) == nil {
+			cs.usersState.recordSuccess()
+		}
+	}
+	if !cs.userCAsState.firstError.IsZero() {
+		if cs.getCache(keyUserCAs, &cs.userCAs) == nil {
+			cs.userCAsState.recordSuccess()
+		}
+	}
+	if !cs.hostCAsState.firstError.IsZero() {
+		if cs.getCache(keyHostCAs, &cs.hostCAs) == nil {
+			cs.hostCAsState.recordSuccess()
+		}
+	}
+	return nil
+}
+
+// checkSchemaVersion stamps backend with cacheSchemaVersion the first time
+// it's used, and wipes it if a previous, incompatible version is found.
+func (cs *CachingAuthClient) checkSchemaVersion() error {
+	if cs.backend == nil {
+		return nil
+	}
+	data, err := cs.backend.Get(keySchemaVersion)
+	if err != nil {
+		return trace.Wrap(cs.backend.Put(keySchemaVersion, []byte(strconv.Itoa(cacheSchemaVersion))))
+	}
+	version, err := strconv.Atoi(string(data))
+	if err != nil || version != cacheSchemaVersion {
+		log.Warningf("cache schema changed (found %q, want %d), wiping stale on-disk cache", data, cacheSchemaVersion)
+		return trace.Wrap(cs.wipeCache())
+	}
+	return nil
+}
+
+// wipeCache deletes every key CachingAuthClient owns in backend and stamps
+// the current schema version.
+func (cs *CachingAuthClient) wipeCache() error {
+	for _, key := range []string{keyDomainName, keyNamespaces, keyProxies, keyUsers, keyUserCAs, keyHostCAs} {
+		cs.backend.Delete(key)
+	}
+	if nodeKeys, err := cs.backend.List(keyNodesPrefix); err == nil {
+		for _, key := range nodeKeys {
+			cs.backend.Delete(key)
+		}
+	}
+	return cs.backend.Put(keySchemaVersion, []byte(strconv.Itoa(cacheSchemaVersion)))
+}
+
+// putCache marshals v and writes it to backend under key. Failures are
+// logged, not returned: a write-through miss should not fail the refresh
+// that triggered it, since the in-memory cache is still correct. Callers
+// must hold cs.mu.
+func (cs *CachingAuthClient) putCache(key string, v interface{}) {
+	if cs.backend == nil {
+		return
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		log.Warningf("state: failed to marshal %s for caching: %v", key, err)
+		return
+	}
+	if err := cs.backend.Put(key, data); err != nil {
+		log.Warningf("state: failed to persist %s: %v", key, err)
+	}
+}
+
+// getCache reads key from backend and unmarshals it into v. Callers must
+// hold cs.mu.
+func (cs *CachingAuthClient) getCache(key string, v interface{}) error {
+	if cs.backend == nil {
+		return trace.NotFound("no backend configured, nothing to hydrate from")
+	}
+	data, err := cs.backend.Get(key)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	return trace.Wrap(json.Unmarshal(data, v))
+}
+
+// putServersCache is putCache specialized for []services.Server. Server is
+// a non-empty interface (services.ServerV2 is its only implementation), and
+// encoding/json cannot unmarshal a JSON object into one -- it has to be
+// round-tripped through the concrete type. Callers must hold cs.mu.
+func (cs *CachingAuthClient) putServersCache(key string, servers []services.Server) {
+	if cs.backend == nil {
+		return
+	}
+	concrete, err := serversToConcrete(servers)
 	if err != nil {
+		log.Warningf("state: failed to marshal %s for caching: %v", key, err)
+		return
+	}
+	cs.putCache(key, concrete)
+}
+
+// getServersCache is getCache specialized for []services.Server; see
+// putServersCache. Callers must hold cs.mu.
+func (cs *CachingAuthClient) getServersCache(key string) ([]services.Server, error) {
+	var concrete []*services.ServerV2
+	if err := cs.getCache(key, &concrete); err != nil {
 		return nil, trace.Wrap(err)
 	}
-	cs := &CachingAuthClient{
-		ap:         ap,
-		domainName: domainName,
-		nodes:      nodes,
-		proxies:    proxies,
-		users:      users,
-		userCAs:    userCAs,
-		hostCAs:    hostCAs,
+	return concreteToServers(concrete), nil
+}
+
+// serversToConcrete downcasts every services.Server to its only concrete
+// implementation so it can be JSON-marshaled.
+func serversToConcrete(servers []services.Server) ([]*services.ServerV2, error) {
+	concrete := make([]*services.ServerV2, len(servers))
+	for i, s := range servers {
+		v2, ok := s.(*services.ServerV2)
+		if !ok {
+			return nil, trace.BadParameter("state: cannot cache server of type %T", s)
+		}
+		concrete[i] = v2
 	}
-	return cs, nil
+	return concrete, nil
+}
+
+// concreteToServers upcasts every *services.ServerV2 back to services.Server.
+func concreteToServers(concrete []*services.ServerV2) []services.Server {
+	servers := make([]services.Server, len(concrete))
+	for i, v2 := range concrete {
+		servers[i] = v2
+	}
+	return servers
 }
 
 // GetDomainName is a part of auth.AccessPoint implementation
 func (cs *CachingAuthClient) GetDomainName() (string, error) {
-	cs.try(func() error {
-		dn, err := cs.ap.GetDomainName()
-		if err == nil {
-			cs.Lock()
-			defer cs.Unlock()
-			cs.domainName = dn
-		}
-		return err
-	})
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	if !cs.domainNameState.usable(cs.maxStaleness) {
+		cacheMisses.WithLabelValues("domain_name").Inc()
+		return "", trace.ConnectionProblem(nil, "domain name cache is stale")
+	}
+	cacheHits.WithLabelValues("domain_name").Inc()
 	return cs.domainName, nil
 }
 
 // GetNamespaces is a part of auth.AccessPoint implementation
 func (cs *CachingAuthClient) GetNamespaces() ([]services.Namespace, error) {
-	cs.try(func() error {
-		namespaces, err := cs.ap.GetNamespaces()
-		if err == nil {
-			cs.Lock()
-			defer cs.Unlock()
-			cs.namespaces = namespaces
-		}
-		return err
-	})
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	if !cs.namespacesState.usable(cs.maxStaleness) {
+		cacheMisses.WithLabelValues("namespaces").Inc()
+		return nil, trace.ConnectionProblem(nil, "namespaces cache is stale")
+	}
+	cacheHits.WithLabelValues("namespaces").Inc()
 	return cs.namespaces, nil
 }
 
 // GetNodes is a part of auth.AccessPoint implementation
 func (cs *CachingAuthClient) GetNodes(namespace string) ([]services.Server, error) {
-	var nsNodes []services.Server
-	var err error
-	cs.try(func() error {
-		nsNodes, err = cs.ap.GetNodes(namespace)
-		if err == nil {
-			cs.Lock()
-			defer cs.Unlock()
-			cs.nodes[namespace] = nsNodes
-		}
-		return err
-	})
-	return nsNodes, nil
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	entry := cs.nodesState[namespace]
+	if entry == nil || !entry.usable(cs.maxStaleness) {
+		cacheMisses.WithLabelValues("nodes").Inc()
+		return nil, trace.ConnectionProblem(nil, "nodes cache for namespace %q is stale", namespace)
+	}
+	cacheHits.WithLabelValues("nodes").Inc()
+	return cs.nodes[namespace], nil
 }
 
 // GetProxies is a part of auth.AccessPoint implementation
 func (cs *CachingAuthClient) GetProxies() ([]services.Server, error) {
-	cs.try(func() error {
-		proxies, err := cs.ap.GetProxies()
-		if err == nil {
-			cs.Lock()
-			defer cs.Unlock()
-			cs.proxies = proxies
-		}
-		return err
-	})
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	if !cs.proxiesState.usable(cs.maxStaleness) {
+		cacheMisses.WithLabelValues("proxies").Inc()
+		return nil, trace.ConnectionProblem(nil, "proxies cache is stale")
+	}
+	cacheHits.WithLabelValues("proxies").Inc()
 	return cs.proxies, nil
 }
 
 // GetCertAuthorities is a part of auth.AccessPoint implementation
 func (cs *CachingAuthClient) GetCertAuthorities(ct services.CertAuthType, loadKeys bool) ([]*services.CertAuthority, error) {
-	cs.try(func() error {
-		retval, err := cs.ap.GetCertAuthorities(ct, loadKeys)
-		if err == nil {
-			cs.Lock()
-			defer cs.Unlock()
-			if ct == services.UserCA {
-				cs.userCAs = retval
-			} else {
-				cs.hostCAs = retval
-			}
-		}
-		return err
-	})
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	name, state, val := "host_cas", cs.hostCAsState, cs.hostCAs
 	if ct == services.UserCA {
-		return cs.userCAs, nil
+		name, state, val = "user_cas", cs.userCAsState, cs.userCAs
+	}
+	if !state.usable(cs.maxStaleness) {
+		cacheMisses.WithLabelValues(name).Inc()
+		return nil, trace.ConnectionProblem(nil, "%s cache is stale", name)
 	}
-	return cs.hostCAs, nil
+	cacheHits.WithLabelValues(name).Inc()
+	return val, nil
 }
 
 // GetUsers is a part of auth.AccessPoint implementation
 func (cs *CachingAuthClient) GetUsers() ([]services.User, error) {
-	cs.try(func() error {
-		users, err := cs.ap.GetUsers()
-		if err == nil {
-			cs.Lock()
-			defer cs.Unlock()
-			cs.users = users
-		}
-		return err
-	})
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	if !cs.usersState.usable(cs.maxStaleness) {
+		cacheMisses.WithLabelValues("users").Inc()
+		return nil, trace.ConnectionProblem(nil, "users cache is stale")
+	}
+	cacheHits.WithLabelValues("users").Inc()
 	return cs.users, nil
 }
 
@@ -208,17 +653,3 @@ func (cs *CachingAuthClient) UpsertNode(s services.Server, ttl time.Duration) er
 func (cs *CachingAuthClient) UpsertProxy(s services.Server, ttl time.Duration) error {
 	return cs.ap.UpsertProxy(s, ttl)
 }
-
-// try calls a given function f and checks for errors. If f() fails, the current
-// time is recorded. Future calls to f will be ingored until sufficient time passes
-// since th last error
-func (cs *CachingAuthClient) try(f func() error) {
-	tooSoon := cs.lastErrorTime.Add(backoffDuration).After(time.Now())
-	if tooSoon {
-		log.Warnf("Not calling auth access point due to recent errors. Using cached value instead")
-		return
-	}
-	if err := f(); err != nil {
-		cs.lastErrorTime = time.Now()
-	}
-}
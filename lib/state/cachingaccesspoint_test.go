@@ -0,0 +1,232 @@
+/*
+Copyright 2017 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package state
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gravitational/trace"
+
+	"github.com/gravitational/teleport/lib/services"
+)
+
+// memBackend is an in-memory Backend used to exercise CachingAuthClient
+// without a real boltdb/etcd dependency.
+type memBackend struct {
+	data map[string][]byte
+}
+
+func newMemBackend() *memBackend {
+	return &memBackend{data: make(map[string][]byte)}
+}
+
+func (m *memBackend) Get(key string) ([]byte, error) {
+	v, ok := m.data[key]
+	if !ok {
+		return nil, trace.NotFound("key %q not found", key)
+	}
+	return v, nil
+}
+
+func (m *memBackend) Put(key string, value []byte) error {
+	m.data[key] = value
+	return nil
+}
+
+func (m *memBackend) List(prefix string) ([]string, error) {
+	var keys []string
+	for k := range m.data {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	return keys, nil
+}
+
+func (m *memBackend) Delete(key string) error {
+	delete(m.data, key)
+	return nil
+}
+
+func (m *memBackend) Close() error { return nil }
+
+// fakeAP is a minimal auth.AccessPoint that can be toggled "down" to
+// simulate the auth server being unreachable.
+type fakeAP struct {
+	down bool
+	// downCAs, if set, fails only GetCertAuthorities, independent of down.
+	downCAs bool
+
+	domainName string
+	namespaces []services.Namespace
+	nodes      map[string][]services.Server
+	proxies    []services.Server
+	users      []services.User
+	userCAs    []*services.CertAuthority
+	hostCAs    []*services.CertAuthority
+}
+
+func (f *fakeAP) GetDomainName() (string, error) {
+	if f.down {
+		return "", trace.ConnectionProblem(nil, "auth server down")
+	}
+	return f.domainName, nil
+}
+
+func (f *fakeAP) GetNamespaces() ([]services.Namespace, error) {
+	if f.down {
+		return nil, trace.ConnectionProblem(nil, "auth server down")
+	}
+	return f.namespaces, nil
+}
+
+func (f *fakeAP) GetNodes(namespace string) ([]services.Server, error) {
+	if f.down {
+		return nil, trace.ConnectionProblem(nil, "auth server down")
+	}
+	return f.nodes[namespace], nil
+}
+
+func (f *fakeAP) GetProxies() ([]services.Server, error) {
+	if f.down {
+		return nil, trace.ConnectionProblem(nil, "auth server down")
+	}
+	return f.proxies, nil
+}
+
+func (f *fakeAP) GetUsers() ([]services.User, error) {
+	if f.down {
+		return nil, trace.ConnectionProblem(nil, "auth server down")
+	}
+	return f.users, nil
+}
+
+func (f *fakeAP) GetCertAuthorities(ct services.CertAuthType, loadKeys bool) ([]*services.CertAuthority, error) {
+	if f.down || f.downCAs {
+		return nil, trace.ConnectionProblem(nil, "auth server down")
+	}
+	if ct == services.UserCA {
+		return f.userCAs, nil
+	}
+	return f.hostCAs, nil
+}
+
+func (f *fakeAP) UpsertNode(s services.Server, ttl time.Duration) error {
+	return trace.NotImplemented("not used by this test")
+}
+
+func (f *fakeAP) UpsertProxy(s services.Server, ttl time.Duration) error {
+	return trace.NotImplemented("not used by this test")
+}
+
+func TestCachingAuthClientHydratesFromDiskWhenAuthIsDown(t *testing.T) {
+	backend := newMemBackend()
+
+	live := &fakeAP{
+		domainName: "example.com",
+		namespaces: []services.Namespace{{Metadata: services.Metadata{Name: "default"}}},
+		proxies:    []services.Server{&services.ServerV2{Metadata: services.Metadata{Name: "proxy1"}}},
+	}
+
+	bootstrap, err := NewCachingAuthClient(live, backend, CacheConfig{})
+	if err != nil {
+		t.Fatalf("unexpected error bringing up the caching client: %s", err)
+	}
+	bootstrap.Close()
+
+	// the auth server is down and the process restarts: a fresh
+	// CachingAuthClient, backed by the same on-disk cache, should still
+	// come up serving the last known-good state.
+	down := &fakeAP{down: true}
+	cs, err := NewCachingAuthClient(down, backend, CacheConfig{})
+	if err != nil {
+		t.Fatalf("expected NewCachingAuthClient to hydrate from disk, got error: %s", err)
+	}
+	defer cs.Close()
+
+	domainName, err := cs.GetDomainName()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if domainName != "example.com" {
+		t.Errorf("expected hydrated domain name %q, got %q", "example.com", domainName)
+	}
+
+	proxies, err := cs.GetProxies()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(proxies) != 1 || proxies[0].GetName() != "proxy1" {
+		t.Errorf("expected 1 hydrated proxy named proxy1, got %+v", proxies)
+	}
+}
+
+func TestCachingAuthClientFailsWithoutBackendOrUpstream(t *testing.T) {
+	down := &fakeAP{down: true}
+	if _, err := NewCachingAuthClient(down, nil, CacheConfig{}); err == nil {
+		t.Fatal("expected an error when neither the auth server nor a backend is available")
+	}
+}
+
+func TestCachingAuthClientStaleIfError(t *testing.T) {
+	live := &fakeAP{
+		domainName: "example.com",
+		namespaces: []services.Namespace{{Metadata: services.Metadata{Name: "default"}}},
+	}
+	cs, err := NewCachingAuthClient(live, nil, CacheConfig{MaxStaleness: time.Millisecond})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer cs.Close()
+
+	// simulate the upstream going down and the stale-if-error window
+	// elapsing: reads should start failing instead of returning whatever
+	// was last cached.
+	live.down = true
+	if err := cs.refreshDomainName(); err == nil {
+		t.Fatal("expected refreshDomainName to surface the upstream error")
+	}
+	time.Sleep(2 * time.Millisecond)
+
+	if _, err := cs.GetDomainName(); err == nil {
+		t.Fatal("expected GetDomainName to report the cache as stale once MaxStaleness elapses")
+	}
+}
+
+// TestCachingAuthClientNeverSucceededIsStale guards against a resource that
+// has never been fetched successfully (no live refresh, no backend to
+// hydrate from) being treated as fresh just because it hasn't hit
+// MaxStaleness yet.
+func TestCachingAuthClientNeverSucceededIsStale(t *testing.T) {
+	live := &fakeAP{
+		domainName: "example.com",
+		namespaces: []services.Namespace{{Metadata: services.Metadata{Name: "default"}}},
+		downCAs:    true,
+	}
+	cs, err := NewCachingAuthClient(live, nil, CacheConfig{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer cs.Close()
+
+	if cas, err := cs.GetCertAuthorities(services.UserCA, false); err == nil {
+		t.Fatalf("expected GetCertAuthorities to report the cache as unavailable, got %+v with no error", cas)
+	}
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2017 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package state
+
+import (
+	"strings"
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/gravitational/trace"
+	"golang.org/x/net/context"
+)
+
+const etcdRequestTimeout = time.Second * 5
+
+// EtcdConfig configures an EtcdBackend.
+type EtcdConfig struct {
+	// Endpoints lists the etcd cluster members to connect to.
+	Endpoints []string
+	// Prefix namespaces every key written by this backend, so several
+	// Teleport clusters can share one etcd cluster.
+	Prefix string
+	// DialTimeout bounds how long to wait for the initial connection.
+	DialTimeout time.Duration
+}
+
+// EtcdBackend shares a cache across an HA pool of proxies by storing it in
+// etcd v3 instead of a local file, so every proxy in the pool observes the
+// same cached state regardless of which one last talked to the auth server.
+type EtcdBackend struct {
+	client *clientv3.Client
+	prefix string
+}
+
+// NewEtcdBackend connects to the etcd cluster described by cfg.
+func NewEtcdBackend(cfg EtcdConfig) (*EtcdBackend, error) {
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   cfg.Endpoints,
+		DialTimeout: cfg.DialTimeout,
+	})
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return &EtcdBackend{client: client, prefix: cfg.Prefix}, nil
+}
+
+func (e *EtcdBackend) key(key string) string {
+	return e.prefix + "/" + key
+}
+
+// Get is a part of the Backend implementation
+func (e *EtcdBackend) Get(key string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), etcdRequestTimeout)
+	defer cancel()
+	resp, err := e.client.Get(ctx, e.key(key))
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, trace.NotFound("key %q not found", key)
+	}
+	return resp.Kvs[0].Value, nil
+}
+
+// Put is a part of the Backend implementation
+func (e *EtcdBackend) Put(key string, value []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), etcdRequestTimeout)
+	defer cancel()
+	_, err := e.client.Put(ctx, e.key(key), string(value))
+	return trace.Wrap(err)
+}
+
+// List is a part of the Backend implementation
+func (e *EtcdBackend) List(prefix string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), etcdRequestTimeout)
+	defer cancel()
+	resp, err := e.client.Get(ctx, e.key(prefix), clientv3.WithPrefix(), clientv3.WithKeysOnly())
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	keys := make([]string, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		keys = append(keys, strings.TrimPrefix(string(kv.Key), e.prefix+"/"))
+	}
+	return keys, nil
+}
+
+// Delete is a part of the Backend implementation
+func (e *EtcdBackend) Delete(key string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), etcdRequestTimeout)
+	defer cancel()
+	_, err := e.client.Delete(ctx, e.key(key))
+	return trace.Wrap(err)
+}
+
+// Close is a part of the Backend implementation
+func (e *EtcdBackend) Close() error {
+	return trace.Wrap(e.client.Close())
+}
@@ -0,0 +1,60 @@
+/*
+Copyright 2017 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package state
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// Prometheus metrics exported by CachingAuthClient, labeled by the cached
+// resource they describe ("domain_name", "namespaces", "nodes", "proxies",
+// "users", "user_cas", "host_cas").
+var (
+	cacheHits = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "teleport",
+		Subsystem: "cache",
+		Name:      "hits_total",
+		Help:      "Number of reads served from CachingAuthClient's in-memory state.",
+	}, []string{"resource"})
+
+	cacheMisses = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "teleport",
+		Subsystem: "cache",
+		Name:      "misses_total",
+		Help:      "Number of reads that fell outside the stale-if-error window and returned an error.",
+	}, []string{"resource"})
+
+	refreshFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "teleport",
+		Subsystem: "cache",
+		Name:      "refresh_failures_total",
+		Help:      "Number of background refreshes that failed to reach the auth server.",
+	}, []string{"resource"})
+
+	lastSuccessTimestamp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "teleport",
+		Subsystem: "cache",
+		Name:      "last_success_timestamp_seconds",
+		Help:      "Unix timestamp of the last successful refresh of a cached resource.",
+	}, []string{"resource"})
+)
+
+func init() {
+	prometheus.MustRegister(cacheHits)
+	prometheus.MustRegister(cacheMisses)
+	prometheus.MustRegister(refreshFailures)
+	prometheus.MustRegister(lastSuccessTimestamp)
+}